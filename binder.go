@@ -0,0 +1,172 @@
+// Original work, Copyright 2017 Pantomath SAS
+// Modified work, Copyright (c) 2019 Charles Francoise
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package popt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Binder holds the state that AddOption, BindOption and Register otherwise read from
+// package-level globals: which *viper.Viper to populate, which FlagSet to register
+// against, and an optional EnvPrefix/EnvKeyReplacer pair used to derive an environment
+// variable for options that don't set Env explicitly.
+//
+// When EnvPrefix is set, an option named "server.port" binds to the environment variable
+// <EnvPrefix>_SERVER_PORT, with dots replaced by underscores. Supply EnvKeyReplacer to
+// customize that translation, e.g. to also fold in dashes.
+//
+// Use a Binder instead of the package-level functions to keep a library's configuration
+// state isolated from the viper global, or in tests that must not leak state between
+// runs.
+type Binder struct {
+	Viper          *viper.Viper
+	Flags          *pflag.FlagSet
+	EnvPrefix      string
+	EnvKeyReplacer *strings.Replacer
+
+	// watch holds the live-reload dispatcher lazily created by Watch/OnChange; see watch.go.
+	watch *watchState
+
+	// mu guards dst below, since Register/RegisterAndBind can run concurrently with a
+	// live-reload dispatch reading it once Watch/OnChange has started.
+	mu sync.Mutex
+
+	// dst holds the struct pointer passed to Register/RegisterAndBind, if any, so Watch
+	// can decode a typed snapshot through mapstructure instead of diffing raw
+	// interface{} values; see watch.go and register.go's typedSnapshot.
+	dst interface{}
+}
+
+// defaultBinder backs the package-level AddOption/BindOption/Register functions. It
+// targets the viper singleton and has no EnvPrefix, matching their historical behavior.
+var defaultBinder = &Binder{Viper: viper.GetViper()}
+
+// NewBinder returns a Binder that adds flags to flags and stores defaults and bindings
+// in v.
+func NewBinder(v *viper.Viper, flags *pflag.FlagSet) *Binder {
+	return &Binder{Viper: v, Flags: flags}
+}
+
+// setDst records dst as the struct Watch/OnChange should mapstructure-decode against for
+// typed diffing, guarded by mu since a live-reload dispatch already in progress reads dst
+// from a different goroutine.
+func (b *Binder) setDst(dst interface{}) {
+	b.mu.Lock()
+	b.dst = dst
+	b.mu.Unlock()
+}
+
+// Add adds opt to b.Flags and b.Viper, as the package-level AddOption does for the
+// default binder.
+func (b *Binder) Add(opt Option) error {
+	return addOption(opt, b.Viper, b.Flags)
+}
+
+// AddOptions calls Add on a list of Options, returning the first error it encounters, or
+// nil if none occurred.
+func (b *Binder) AddOptions(opts []Option) error {
+	for _, o := range opts {
+		if err := b.Add(o); err != nil {
+			return fmt.Errorf("failed to add option: %s", err)
+		}
+	}
+	return nil
+}
+
+// Bind binds opt's environment variable and flag into b.Viper. If opt.Env is empty and
+// b.EnvPrefix is set, the environment variable is derived from opt.Name and b.EnvPrefix.
+func (b *Binder) Bind(opt Option) error {
+	return b.bindOption(opt, b.Flags)
+}
+
+// BindOptions calls Bind on a list of Options, returning the first error it encounters,
+// or nil if none occurred.
+func (b *Binder) BindOptions(opts []Option) error {
+	for _, o := range opts {
+		if err := b.Bind(o); err != nil {
+			return fmt.Errorf("failed to add option: %s", err)
+		}
+	}
+	return nil
+}
+
+// AddAndBind calls Add followed by Bind. Returns an error if either fails.
+func (b *Binder) AddAndBind(opt Option) error {
+	if err := b.Add(opt); err != nil {
+		return fmt.Errorf("failed to add option: %s", err)
+	}
+	if err := b.Bind(opt); err != nil {
+		return fmt.Errorf("failed to bind option: %s", err)
+	}
+	return nil
+}
+
+// AddAndBindOptions calls AddAndBind on a list of Options, returning the first error it
+// encounters, or nil if none occurred.
+func (b *Binder) AddAndBindOptions(opts []Option) error {
+	for _, o := range opts {
+		if err := b.AddAndBind(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindOption is shared by Bind and the flags-taking package-level BindOption, which
+// calls it against defaultBinder with an explicit FlagSet rather than b.Flags.
+func (b *Binder) bindOption(opt Option, flags *pflag.FlagSet) error {
+	envKey := opt.Env
+	if envKey == "" && b.EnvPrefix != "" {
+		envKey = b.envKeyFor(opt.Name)
+	}
+
+	// Bind environment variable
+	if opt.Name != "" && envKey != "" {
+		if err := b.Viper.BindEnv(opt.Name, envKey); err != nil {
+			return err
+		}
+	}
+
+	// Bind flag
+	if flags != nil && opt.Flag != "" {
+		flag := flags.Lookup(opt.Flag)
+		if flag == nil {
+			return fmt.Errorf("flag %s not found", opt.Flag)
+		}
+		if opt.Name != "" {
+			b.Viper.BindPFlag(opt.Name, flag)
+		}
+	}
+
+	return nil
+}
+
+// envKeyFor derives an environment variable name for name from b.EnvPrefix, replacing
+// dots with underscores unless b.EnvKeyReplacer says otherwise.
+func (b *Binder) envKeyFor(name string) string {
+	key := strings.ToUpper(name)
+	if b.EnvKeyReplacer != nil {
+		key = b.EnvKeyReplacer.Replace(key)
+	} else {
+		key = strings.ReplaceAll(key, ".", "_")
+	}
+	return strings.ToUpper(b.EnvPrefix) + "_" + key
+}
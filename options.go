@@ -138,7 +138,6 @@ package popt
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -150,36 +149,54 @@ type Option struct {
 	Default interface{} `json:"default"` // The default value of the option. Mandatory, as the default value is used to infer the option type.
 	Usage   string      `json:"usage"`   // A description of the option.
 
+	// Type names the registered option type to use, for the cases where the Go type of
+	// Default alone doesn't disambiguate it, e.g. "count" versus a plain int, or any
+	// slice default loaded from JSON, which decodes to []interface{} rather than e.g.
+	// []string. The names built into popt are "count", "int64", "uint", "uint64",
+	// "float32", "stringSlice", "intSlice", "boolSlice", "ip", "ipMask" and "ipNet";
+	// types added through RegisterType are matched by Go type only, not by name.
+	// Optional: when empty, the type is inferred from Default via reflection, as before.
+	Type string `json:"type"`
+
 	Flag  string `json:"flag"`  // The name of the command-line flag.
 	Short string `json:"short"` // A shorthand for the flag (optional).
 
 	Env string `json:"env"` // An environment variable to bind this option to (optional).
+
+	Required   bool `json:"required"`   // If true, Validate reports an error when the option isn't set after parsing.
+	Hidden     bool `json:"hidden"`     // If true, AddOptionToCommand marks the flag hidden from help output.
+	Persistent bool `json:"persistent"` // If true, AddOptionToCommand registers the flag on cmd.PersistentFlags() instead of cmd.Flags().
+
+	// Validate, if set, is called by Validate with the option's resolved value once flags,
+	// env vars and any config file have been read. A non-nil error is collected into the
+	// ValidationError returned for the whole batch.
+	Validate func(interface{}) error `json:"-"`
 }
 
 // AddOption adds an option to the program. If opt.Default is set, it sets the default value in viper. If flags is not
 // nil and opt.Flag is set, the option is configuration-only. If opt.Name is empty, and opt.Flag is set, the
 // option is flag-only. Use this when setting up flags and configuration options, typically at init time.
+//
+// AddOption operates against the package-level viper singleton; use a Binder to target a specific *viper.Viper
+// instead.
 func AddOption(opt Option, flags *pflag.FlagSet) error {
+	return addOption(opt, viper.GetViper(), flags)
+}
+
+func addOption(opt Option, v *viper.Viper, flags *pflag.FlagSet) error {
 	// Set default
 	if opt.Name != "" && opt.Default != nil {
-		viper.SetDefault(opt.Name, opt.Default)
+		v.SetDefault(opt.Name, opt.Default)
 	}
 
 	// Set flag
 	if flags != nil && opt.Flag != "" {
-		switch def := opt.Default.(type) {
-		case bool:
-			flags.BoolP(opt.Flag, opt.Short, def, opt.Usage)
-		case int:
-			flags.IntP(opt.Flag, opt.Short, def, opt.Usage)
-		case float64:
-			flags.Float64P(opt.Flag, opt.Short, def, opt.Usage)
-		case string:
-			flags.StringP(opt.Flag, opt.Short, def, opt.Usage)
-		case time.Duration:
-			flags.DurationP(opt.Flag, opt.Short, def, opt.Usage)
-		default:
-			return fmt.Errorf("unsupported option type: %T", def)
+		register, def, err := resolveOptionType(opt)
+		if err != nil {
+			return err
+		}
+		if err := register(flags, opt.Flag, opt.Short, def, opt.Usage); err != nil {
+			return err
 		}
 	}
 
@@ -198,26 +215,11 @@ func AddOptions(opts []Option, flags *pflag.FlagSet) error {
 
 // BindOption binds the environment variables and flags to viper. Use this when running the executable, typically at
 // the start of a cobra command.
+//
+// BindOption operates against the package-level viper singleton; use a Binder to target a specific *viper.Viper, or
+// to bind an environment variable automatically from an EnvPrefix without setting opt.Env.
 func BindOption(opt Option, flags *pflag.FlagSet) error {
-	// Bind environment variable
-	if opt.Name != "" && opt.Env != "" {
-		if err := viper.BindEnv(opt.Name, opt.Env); err != nil {
-			return err
-		}
-	}
-
-	// Bind flag
-	if flags != nil && opt.Flag != "" {
-		flag := flags.Lookup(opt.Flag)
-		if flag == nil {
-			return fmt.Errorf("flag %s not found", opt.Flag)
-		}
-		if opt.Name != "" {
-			viper.BindPFlag(opt.Name, flag)
-		}
-	}
-
-	return nil
+	return defaultBinder.bindOption(opt, flags)
 }
 
 // BindOptions calls BindOption on a list of Options returning the first error it encounters, or nil if none occurred.
@@ -0,0 +1,401 @@
+// Original work, Copyright 2017 Pantomath SAS
+// Modified work, Copyright (c) 2019 Charles Francoise
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package popt
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// tagName is the struct tag key popt looks for when registering options declaratively.
+const tagName = "popt"
+
+// Register walks the fields of dst, which must be a pointer to a struct, and calls
+// AddOption for every field carrying a `popt` tag. The tag is a comma-separated list of
+// key=value attributes: name, flag, short, env, usage, default and type, plus the bare
+// attributes required, hidden and persistent, which set the matching Option field. type
+// selects a namedTypes entry the same way Option.Type does directly, and is only needed
+// when the field's Go type doesn't already disambiguate it, e.g. an int field tagged
+// `popt:"name=verbosity,flag=verbose,short=v,type=count"` registers a count flag instead
+// of a plain int one. For example:
+//
+//	type Config struct {
+//		Port int `popt:"name=server.port,flag=port,short=p,env=HELLO_PORT,usage=the port,default=8080,required"`
+//	}
+//
+// Unlike AddOption called directly, the Default passed along for each field is parsed
+// from the tag's default attribute using the field's own Go type, so it no longer has to
+// be guessed from an untyped literal the way it does with the JSON caveat documented in
+// the package comment.
+//
+// Fields of struct type (other than time.Duration, which Kind() reports as an int64) are
+// walked recursively, and their tagged name is used as a dotted prefix for the nested
+// fields, e.g. a Server struct field tagged `popt:"name=server"` containing a Port field
+// tagged `popt:"name=port"` registers under the viper key "server.port".
+//
+// Unexported fields are skipped even when tagged, the same way encoding/json ignores
+// them, since their value can't be read or set through reflection.
+//
+// Like AddOption, Register is meant to be called once at init time. Follow it with
+// BindOption field-by-field once flags are ready to be bound (or call RegisterAndBind in
+// place of Register to do both; calling it after Register registers every flag a second
+// time), then Unmarshal(dst) after pflag.Parse() to populate dst with the resolved values.
+//
+// Register operates against the package-level viper singleton and records dst on
+// defaultBinder, so a subsequent package-level Watch or OnChange call can
+// mapstructure-decode it for typed diffing; call (*Binder).Register to target a specific
+// *viper.Viper instead. defaultBinder only remembers one dst at a time, the same way it
+// only drives one viper.OnConfigChange dispatcher at a time, so if your program calls
+// package-level Register for more than one struct, only the most recent one gets typed
+// diffing; give each its own Binder via NewBinder instead.
+func Register(dst interface{}, flags *pflag.FlagSet) error {
+	defaultBinder.setDst(dst)
+	return registerStruct(dst, &Binder{Viper: defaultBinder.Viper, Flags: flags}, "", false)
+}
+
+// RegisterAndBind is equivalent to calling Register on dst followed by BindOption for
+// every tagged field, mirroring AddAndBindOption. Use it when there is a single FlagSet
+// and you want declaration and binding to happen together, typically at the start of a
+// cobra command.
+func RegisterAndBind(dst interface{}, flags *pflag.FlagSet) error {
+	defaultBinder.setDst(dst)
+	return registerStruct(dst, &Binder{Viper: defaultBinder.Viper, Flags: flags}, "", true)
+}
+
+// Register is the Binder-aware equivalent of the package-level Register function.
+func (b *Binder) Register(dst interface{}) error {
+	b.setDst(dst)
+	return registerStruct(dst, b, "", false)
+}
+
+// RegisterAndBind is the Binder-aware equivalent of the package-level RegisterAndBind
+// function.
+func (b *Binder) RegisterAndBind(dst interface{}) error {
+	b.setDst(dst)
+	return registerStruct(dst, b, "", true)
+}
+
+// Unmarshal decodes the current viper configuration into dst, the same struct pointer
+// passed to Register or RegisterAndBind. Call it after pflag.Parse() so that flags, env
+// vars and any config file have all been read.
+//
+// Unmarshal defers to viper.Unmarshal, which matches config keys against dst's exported
+// field names case-insensitively; keep field names aligned with the last segment of each
+// field's popt name attribute, or add your own mapstructure tags if they must differ.
+//
+// Unmarshal operates against the package-level viper singleton; use (*Binder).Unmarshal to
+// target a specific *viper.Viper instead.
+func Unmarshal(dst interface{}) error {
+	return defaultBinder.Unmarshal(dst)
+}
+
+// Unmarshal is the Binder-aware equivalent of the package-level Unmarshal function.
+func (b *Binder) Unmarshal(dst interface{}) error {
+	return b.Viper.Unmarshal(dst)
+}
+
+// walkTaggedFields walks the exported, popt-tagged fields of dst, which must be a pointer
+// to a struct, recursing into nested struct fields with their tagged name joined onto
+// prefix as described on Register, and calls visit once per leaf field. registerStruct
+// and collectFieldValues are both thin wrappers around this shared traversal, so the two
+// can't drift apart on which fields they see.
+func walkTaggedFields(dst interface{}, prefix string, visit func(field reflect.StructField, fv reflect.Value, name string, attrs map[string]string) error) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("popt: Register expects a pointer to a struct, got %T", dst)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag, ok := field.Tag.Lookup(tagName)
+		if !ok || tag == "-" {
+			continue
+		}
+
+		attrs, err := parsePoptTag(tag)
+		if err != nil {
+			return fmt.Errorf("popt: field %s: %w", field.Name, err)
+		}
+
+		fv := rv.Field(i)
+		name := joinKey(prefix, attrs["name"])
+
+		if isNestedStruct(field.Type) {
+			if attrs["name"] == "" {
+				return fmt.Errorf("popt: field %s: nested struct fields require a name attribute", field.Name)
+			}
+			if err := walkTaggedFields(fv.Addr().Interface(), name, visit); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := visit(field, fv, name, attrs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// registerStruct is the recursive implementation behind (*Binder).Register and
+// (*Binder).RegisterAndBind, additionally calling b.Bind per field when bind is true.
+func registerStruct(dst interface{}, b *Binder, prefix string, bind bool) error {
+	return walkTaggedFields(dst, prefix, func(field reflect.StructField, fv reflect.Value, name string, attrs map[string]string) error {
+		opt := Option{
+			Name:       name,
+			Type:       attrs["type"],
+			Flag:       attrs["flag"],
+			Short:      attrs["short"],
+			Env:        attrs["env"],
+			Usage:      attrs["usage"],
+			Required:   tagFlag(attrs, "required"),
+			Hidden:     tagFlag(attrs, "hidden"),
+			Persistent: tagFlag(attrs, "persistent"),
+		}
+
+		def, err := defaultForField(fv, attrs["default"])
+		if err != nil {
+			return fmt.Errorf("popt: field %s: %w", field.Name, err)
+		}
+		opt.Default = def
+
+		if err := b.Add(opt); err != nil {
+			return fmt.Errorf("popt: field %s: %w", field.Name, err)
+		}
+		if bind {
+			if err := b.Bind(opt); err != nil {
+				return fmt.Errorf("popt: field %s: %w", field.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// collectFieldValues walks dst via walkTaggedFields, returning a flat map of each tagged
+// leaf field's current value keyed by its dotted popt name. It backs
+// (*Binder).typedSnapshot, which runs it against a freshly mapstructure-decoded copy of
+// dst so Watch can diff typed values instead of viper's untyped interface{}.
+func collectFieldValues(dst interface{}, prefix string) map[string]interface{} {
+	values := map[string]interface{}{}
+	_ = walkTaggedFields(dst, prefix, func(_ reflect.StructField, fv reflect.Value, name string, _ map[string]string) error {
+		if name != "" {
+			values[name] = fv.Interface()
+		}
+		return nil
+	})
+	return values
+}
+
+// typedSnapshot decodes the current viper configuration into a fresh copy of the struct
+// pointer passed to Register/RegisterAndBind, and returns its tagged field values keyed
+// by dotted popt name. It returns a nil map, with no error, when b has no dst to decode
+// into, which tells callers to fall back to raw viper.Get values.
+//
+// Decoding goes through b.Viper.Unmarshal rather than calling mapstructure directly, so it
+// picks up the same decode hooks Unmarshal(dst) does, such as the one that parses a
+// "1h"-style string into a time.Duration; mapstructure on its own wouldn't convert it.
+func (b *Binder) typedSnapshot() (map[string]interface{}, error) {
+	b.mu.Lock()
+	dst := b.dst
+	b.mu.Unlock()
+
+	if dst == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	decoded := reflect.New(rv.Elem().Type()).Interface()
+	if err := b.Viper.Unmarshal(decoded); err != nil {
+		return nil, fmt.Errorf("popt: failed to decode typed snapshot: %w", err)
+	}
+
+	return collectFieldValues(decoded, ""), nil
+}
+
+// poptAttrs is the fixed vocabulary of popt tag attributes. parsePoptTag uses it to tell a
+// new attribute apart from a comma inside the previous one's value, e.g. the "2" and "3" in
+// a slice-typed field's `default=1,2,3`.
+var poptAttrs = map[string]bool{
+	"name": true, "flag": true, "short": true, "env": true, "usage": true,
+	"default": true, "type": true, "required": true, "hidden": true, "persistent": true,
+}
+
+// parsePoptTag splits a `popt:"key=value,key=value"` tag into a map of attributes.
+// Attributes without a value, such as the bare "required", are stored with an empty
+// string; registerStruct reads those via tagFlag to populate Option's boolean fields.
+//
+// A comma-separated part that isn't one of poptAttrs is treated as a continuation of the
+// previous attribute's value rather than a malformed attribute of its own, so a slice
+// default such as `default=1,2,3` survives the same top-level split that separates
+// attributes from each other.
+func parsePoptTag(tag string) (map[string]string, error) {
+	attrs := map[string]string{}
+	lastKey := ""
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		key := strings.TrimSpace(kv[0])
+
+		if lastKey != "" && !poptAttrs[key] {
+			attrs[lastKey] += "," + part
+			continue
+		}
+
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag attribute %q", part)
+		}
+		value := ""
+		if len(kv) == 2 {
+			value = strings.TrimSpace(kv[1])
+		}
+		attrs[key] = value
+		lastKey = key
+	}
+	return attrs, nil
+}
+
+// tagFlag reports whether key is present in attrs at all, which is how bare boolean
+// attributes like "required", "hidden" and "persistent" show up once parsePoptTag has
+// split the tag: present with an empty value if bare, present with an explicit value if
+// the field was written as e.g. "required=true".
+func tagFlag(attrs map[string]string, key string) bool {
+	v, ok := attrs[key]
+	if !ok {
+		return false
+	}
+	if v == "" {
+		return true
+	}
+	b, err := strconv.ParseBool(v)
+	return err == nil && b
+}
+
+// joinKey joins a dotted viper key prefix with a name, omitting the separator when either
+// side is empty.
+func joinKey(prefix, name string) string {
+	switch {
+	case prefix == "":
+		return name
+	case name == "":
+		return prefix
+	default:
+		return prefix + "." + name
+	}
+}
+
+// isNestedStruct reports whether t should be walked recursively by registerStruct rather
+// than treated as a leaf option type. time.Duration has a Struct-free underlying kind
+// (int64), so it already falls through to defaultForField without special-casing here.
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct
+}
+
+// defaultForField parses the string form of a default tag attribute into a value matching
+// fv's type, falling back to fv's current (zero) value when no default was given. The set
+// of types handled here mirrors popt's built-in flag types; a field of a type added through
+// RegisterType can only take its zero value, and a default attribute on it is reported as
+// an unsupported field type. Named types
+// such as "count" reuse an underlying Go type defaultForField already handles (count's
+// field is a plain int), so they need no case of their own here; registerStruct wires the
+// type tag attribute into Option.Type for resolveOptionType to dispatch on instead.
+func defaultForField(fv reflect.Value, def string) (interface{}, error) {
+	if def == "" {
+		return fv.Interface(), nil
+	}
+
+	switch fv.Interface().(type) {
+	case bool:
+		return strconv.ParseBool(def)
+	case int:
+		n, err := strconv.ParseInt(def, 10, strconv.IntSize)
+		return int(n), err
+	case int64:
+		return strconv.ParseInt(def, 10, 64)
+	case uint:
+		n, err := strconv.ParseUint(def, 10, strconv.IntSize)
+		return uint(n), err
+	case uint16:
+		n, err := strconv.ParseUint(def, 10, 16)
+		return uint16(n), err
+	case uint64:
+		return strconv.ParseUint(def, 10, 64)
+	case float32:
+		n, err := strconv.ParseFloat(def, 32)
+		return float32(n), err
+	case float64:
+		return strconv.ParseFloat(def, 64)
+	case string:
+		return def, nil
+	case time.Duration:
+		return time.ParseDuration(def)
+	case net.IP:
+		ip := net.ParseIP(def)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP default %q", def)
+		}
+		return ip, nil
+	case net.IPMask:
+		return toIPMask(def)
+	case *net.IPNet:
+		return toIPNet(def)
+	case []string:
+		return strings.Split(def, ","), nil
+	case []int:
+		parts := strings.Split(def, ",")
+		out := make([]int, len(parts))
+		for i, p := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return nil, fmt.Errorf("invalid int default %q: %w", p, err)
+			}
+			out[i] = n
+		}
+		return out, nil
+	case []bool:
+		parts := strings.Split(def, ",")
+		out := make([]bool, len(parts))
+		for i, p := range parts {
+			v, err := strconv.ParseBool(strings.TrimSpace(p))
+			if err != nil {
+				return nil, fmt.Errorf("invalid bool default %q: %w", p, err)
+			}
+			out[i] = v
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported field type: %s", fv.Type())
+	}
+}
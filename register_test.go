@@ -0,0 +1,213 @@
+// Original work, Copyright 2017 Pantomath SAS
+// Modified work, Copyright (c) 2019 Charles Francoise
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package popt
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestRegisterStructTags(t *testing.T) {
+	type Config struct {
+		Port     int    `popt:"name=port,flag=port,default=8080,required"`
+		Hidden   string `popt:"name=hidden,flag=hidden,default=x,hidden"`
+		Exposed  bool   `popt:"name=persistent,flag=persistent,default=false,persistent"`
+		unexport int    `popt:"name=unexport,flag=unexport,default=1"`
+		Skipped  string `popt:"-"`
+		Untagged string
+	}
+
+	var cfg Config
+	v := viper.New()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	b := NewBinder(v, flags)
+
+	if err := b.Register(&cfg); err != nil {
+		t.Fatalf("Register returned an error: %v", err)
+	}
+
+	if flags.Lookup("unexport") != nil {
+		t.Fatal("unexported field should not have registered a flag")
+	}
+	numFlags := 0
+	flags.VisitAll(func(*pflag.Flag) { numFlags++ })
+	if numFlags != 3 {
+		t.Fatalf("got %d flags, want 3: Skipped field tagged \"-\" and Untagged should not have registered a flag", numFlags)
+	}
+
+	if v.GetInt("port") != 8080 {
+		t.Fatalf("got default port %d, want 8080", v.GetInt("port"))
+	}
+	if flags.Lookup("port") == nil {
+		t.Fatal("expected a port flag to be registered")
+	}
+	if flags.Lookup("hidden") == nil {
+		t.Fatal("expected a hidden flag to be registered")
+	}
+	if flags.Lookup("persistent") == nil {
+		t.Fatal("expected a persistent flag to be registered")
+	}
+}
+
+func TestParsePoptTagBooleanAttributes(t *testing.T) {
+	attrs, err := parsePoptTag("name=port,flag=port,default=8080,required,hidden,persistent")
+	if err != nil {
+		t.Fatalf("parsePoptTag returned an error: %v", err)
+	}
+
+	for _, key := range []string{"required", "hidden", "persistent"} {
+		if !tagFlag(attrs, key) {
+			t.Fatalf("expected bare attribute %q to be true", key)
+		}
+	}
+}
+
+func TestTagFlag(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs map[string]string
+		key   string
+		want  bool
+	}{
+		{"absent", map[string]string{}, "required", false},
+		{"bare", map[string]string{"required": ""}, "required", true},
+		{"explicit true", map[string]string{"required": "true"}, "required", true},
+		{"explicit false", map[string]string{"required": "false"}, "required", false},
+		{"invalid value", map[string]string{"required": "nope"}, "required", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tagFlag(tt.attrs, tt.key); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageRegisterSetsDefaultBinderDst(t *testing.T) {
+	t.Cleanup(func() { defaultBinder.dst = nil })
+
+	type Config struct {
+		Port int `popt:"name=port,flag=port,default=8080"`
+	}
+
+	var cfg Config
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	if err := Register(&cfg, flags); err != nil {
+		t.Fatalf("Register returned an error: %v", err)
+	}
+
+	if defaultBinder.dst != &cfg {
+		t.Fatal("package-level Register should set defaultBinder.dst, so package-level Watch can decode typed snapshots")
+	}
+}
+
+func TestRegisterUnexportedFieldDoesNotPanic(t *testing.T) {
+	type Config struct {
+		port int `popt:"name=port,flag=port,default=8080"`
+	}
+
+	var cfg Config
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	if err := Register(&cfg, flags); err != nil {
+		t.Fatalf("Register returned an error: %v", err)
+	}
+	if flags.Lookup("port") != nil {
+		t.Fatal("unexported field should not have registered a flag")
+	}
+}
+
+func TestRegisterStructTagSliceAndIPDefaults(t *testing.T) {
+	type Config struct {
+		Ports  []int      `popt:"name=ports,flag=ports,default=1,2,3"`
+		Debug  []bool     `popt:"name=debug,flag=debug,default=true,false"`
+		Mask   net.IPMask `popt:"name=mask,flag=mask,default=255.255.255.0"`
+		Subnet *net.IPNet `popt:"name=subnet,flag=subnet,default=192.168.0.0/24"`
+	}
+
+	var cfg Config
+	v := viper.New()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	b := NewBinder(v, flags)
+
+	if err := b.Register(&cfg); err != nil {
+		t.Fatalf("Register returned an error: %v", err)
+	}
+
+	if got := v.Get("ports"); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("got ports default %#v, want []int{1, 2, 3}", got)
+	}
+	if got := v.Get("debug"); !reflect.DeepEqual(got, []bool{true, false}) {
+		t.Fatalf("got debug default %#v, want []bool{true, false}", got)
+	}
+
+	wantMask := net.IPMask(net.ParseIP("255.255.255.0").To4())
+	if got, ok := v.Get("mask").(net.IPMask); !ok || !reflect.DeepEqual(got, wantMask) {
+		t.Fatalf("got mask default %#v, want %#v", v.Get("mask"), wantMask)
+	}
+
+	if got, ok := v.Get("subnet").(*net.IPNet); !ok || got.String() != "192.168.0.0/24" {
+		t.Fatalf("got subnet default %#v, want 192.168.0.0/24", v.Get("subnet"))
+	}
+}
+
+func TestRegisterStructTagCountType(t *testing.T) {
+	type Config struct {
+		Verbosity int `popt:"name=verbosity,flag=verbose,short=v,type=count"`
+	}
+
+	var cfg Config
+	v := viper.New()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	b := NewBinder(v, flags)
+
+	if err := b.Register(&cfg); err != nil {
+		t.Fatalf("Register returned an error: %v", err)
+	}
+
+	flag := flags.Lookup("verbose")
+	if flag == nil {
+		t.Fatal("expected a verbose flag to be registered")
+	}
+	if flag.Value.Type() != "count" {
+		t.Fatalf("got flag type %q, want \"count\"", flag.Value.Type())
+	}
+}
+
+func TestRegisterNestedStruct(t *testing.T) {
+	type Server struct {
+		Port int `popt:"name=port,flag=port,default=9090"`
+	}
+	type Config struct {
+		Server Server `popt:"name=server"`
+	}
+
+	var cfg Config
+	v := viper.New()
+	b := &Binder{Viper: v}
+	if err := b.Register(&cfg); err != nil {
+		t.Fatalf("Register returned an error: %v", err)
+	}
+
+	if got := v.GetInt("server.port"); got != 9090 {
+		t.Fatalf("got server.port default %d, want 9090", got)
+	}
+}
@@ -0,0 +1,352 @@
+// Original work, Copyright 2017 Pantomath SAS
+// Modified work, Copyright (c) 2019 Charles Francoise
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package popt
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// FlagRegisterer registers a single flag named name (with optional shorthand) on fs,
+// using def as its default value and usage as its description. It is the shape both
+// AddOption's built-in types and types added through RegisterType share.
+type FlagRegisterer func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error
+
+// typeRegistry dispatches AddOption's flag registration by the reflect.Type of
+// opt.Default, for the common case where Go's own type system already disambiguates the
+// option, e.g. a []string default is unambiguously a string slice flag.
+var typeRegistry = map[reflect.Type]FlagRegisterer{}
+
+// RegisterType adds support for a new Option field type. sample is a zero value of the
+// Go type AddOption (and Register) should recognize, e.g. zapcore.InfoLevel for a custom
+// zapcore.Level; register is called with the option's default value, already asserted to
+// sample's type, to create the matching pflag flag. This lets downstream users plug in
+// their own flag kinds without forking popt.
+func RegisterType(sample interface{}, register FlagRegisterer) {
+	typeRegistry[reflect.TypeOf(sample)] = register
+}
+
+// namedType pairs a FlagRegisterer with a coerce step that normalizes an Option's Default
+// into the type the registerer expects, so a value decoded from JSON (where a string
+// slice default arrives as []interface{} and every number as float64) still works.
+type namedType struct {
+	register FlagRegisterer
+	coerce   func(interface{}) (interface{}, error)
+}
+
+// namedTypes dispatches by Option.Type, for built-in types that reflect.Type alone can't
+// tell apart from a JSON-decoded Default, such as "count" (an int flag with its own
+// pflag constructor) versus a plain "int", or a string slice default that arrived as
+// []interface{}.
+var namedTypes = map[string]namedType{}
+
+func init() {
+	RegisterType(false, func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.BoolP(name, short, def.(bool), usage)
+		return nil
+	})
+	RegisterType(int(0), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.IntP(name, short, def.(int), usage)
+		return nil
+	})
+	RegisterType(int64(0), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.Int64P(name, short, def.(int64), usage)
+		return nil
+	})
+	RegisterType(uint(0), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.UintP(name, short, def.(uint), usage)
+		return nil
+	})
+	RegisterType(uint16(0), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.Uint16P(name, short, def.(uint16), usage)
+		return nil
+	})
+	RegisterType(uint64(0), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.Uint64P(name, short, def.(uint64), usage)
+		return nil
+	})
+	RegisterType(float32(0), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.Float32P(name, short, def.(float32), usage)
+		return nil
+	})
+	RegisterType(float64(0), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.Float64P(name, short, def.(float64), usage)
+		return nil
+	})
+	RegisterType("", func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.StringP(name, short, def.(string), usage)
+		return nil
+	})
+	RegisterType(time.Duration(0), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.DurationP(name, short, def.(time.Duration), usage)
+		return nil
+	})
+	RegisterType([]string(nil), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.StringSliceP(name, short, def.([]string), usage)
+		return nil
+	})
+	RegisterType([]int(nil), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.IntSliceP(name, short, def.([]int), usage)
+		return nil
+	})
+	RegisterType([]bool(nil), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.BoolSliceP(name, short, def.([]bool), usage)
+		return nil
+	})
+	RegisterType(net.IP(nil), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.IPP(name, short, def.(net.IP), usage)
+		return nil
+	})
+	RegisterType(net.IPMask(nil), func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.IPMaskP(name, short, def.(net.IPMask), usage)
+		return nil
+	})
+	RegisterType(&net.IPNet{}, func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.IPNetP(name, short, *def.(*net.IPNet), usage)
+		return nil
+	})
+
+	registerNamedType("count", func(fs *pflag.FlagSet, name, short string, def interface{}, usage string) error {
+		fs.CountP(name, short, usage)
+		return nil
+	}, toInt)
+	registerNamedType("int64", typeRegistry[reflect.TypeOf(int64(0))], toInt64)
+	registerNamedType("uint", typeRegistry[reflect.TypeOf(uint(0))], toUint)
+	registerNamedType("uint64", typeRegistry[reflect.TypeOf(uint64(0))], toUint64)
+	registerNamedType("float32", typeRegistry[reflect.TypeOf(float32(0))], toFloat32)
+	registerNamedType("stringSlice", typeRegistry[reflect.TypeOf([]string(nil))], toStringSlice)
+	registerNamedType("intSlice", typeRegistry[reflect.TypeOf([]int(nil))], toIntSlice)
+	registerNamedType("boolSlice", typeRegistry[reflect.TypeOf([]bool(nil))], toBoolSlice)
+	registerNamedType("ip", typeRegistry[reflect.TypeOf(net.IP(nil))], toIP)
+	registerNamedType("ipMask", typeRegistry[reflect.TypeOf(net.IPMask(nil))], toIPMask)
+	registerNamedType("ipNet", typeRegistry[reflect.TypeOf(&net.IPNet{})], toIPNet)
+}
+
+func registerNamedType(name string, register FlagRegisterer, coerce func(interface{}) (interface{}, error)) {
+	namedTypes[name] = namedType{register: register, coerce: coerce}
+}
+
+// resolveOptionType picks the FlagRegisterer for opt and coerces opt.Default into the
+// value it expects. When opt.Type is set, it is looked up in namedTypes; otherwise the
+// Go type of opt.Default is looked up directly in typeRegistry.
+func resolveOptionType(opt Option) (FlagRegisterer, interface{}, error) {
+	if opt.Type != "" {
+		nt, ok := namedTypes[opt.Type]
+		if !ok {
+			return nil, nil, fmt.Errorf("popt: unknown option type %q", opt.Type)
+		}
+		def, err := nt.coerce(opt.Default)
+		if err != nil {
+			return nil, nil, fmt.Errorf("popt: option %q: %w", opt.Name, err)
+		}
+		return nt.register, def, nil
+	}
+
+	register, ok := typeRegistry[reflect.TypeOf(opt.Default)]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported option type: %T", opt.Default)
+	}
+	return register, opt.Default, nil
+}
+
+func toInt(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as int", def)
+	}
+}
+
+func toInt64(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return int64(0), nil
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as int64", def)
+	}
+}
+
+func toUint(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return uint(0), nil
+	case uint:
+		return v, nil
+	case int:
+		return uint(v), nil
+	case float64:
+		return uint(v), nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as uint", def)
+	}
+}
+
+func toUint64(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return uint64(0), nil
+	case uint64:
+		return v, nil
+	case int:
+		return uint64(v), nil
+	case float64:
+		return uint64(v), nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as uint64", def)
+	}
+}
+
+func toFloat32(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return float32(0), nil
+	case float32:
+		return v, nil
+	case float64:
+		return float32(v), nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as float32", def)
+	}
+}
+
+func toStringSlice(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return []string(nil), nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		out := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot use %T element as string", e)
+			}
+			out[i] = s
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as []string", def)
+	}
+}
+
+func toIntSlice(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return []int(nil), nil
+	case []int:
+		return v, nil
+	case []interface{}:
+		out := make([]int, len(v))
+		for i, e := range v {
+			f, ok := e.(float64)
+			if !ok {
+				return nil, fmt.Errorf("cannot use %T element as int", e)
+			}
+			out[i] = int(f)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as []int", def)
+	}
+}
+
+func toBoolSlice(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return []bool(nil), nil
+	case []bool:
+		return v, nil
+	case []interface{}:
+		out := make([]bool, len(v))
+		for i, e := range v {
+			b, ok := e.(bool)
+			if !ok {
+				return nil, fmt.Errorf("cannot use %T element as bool", e)
+			}
+			out[i] = b
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as []bool", def)
+	}
+}
+
+func toIP(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return net.IP(nil), nil
+	case net.IP:
+		return v, nil
+	case string:
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP %q", v)
+		}
+		return ip, nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as net.IP", def)
+	}
+}
+
+func toIPMask(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return net.IPMask(nil), nil
+	case net.IPMask:
+		return v, nil
+	case string:
+		ip := net.ParseIP(v)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid IP mask %q", v)
+		}
+		return net.IPMask(ip.To4()), nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as net.IPMask", def)
+	}
+}
+
+func toIPNet(def interface{}) (interface{}, error) {
+	switch v := def.(type) {
+	case nil:
+		return &net.IPNet{}, nil
+	case *net.IPNet:
+		return v, nil
+	case string:
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", v, err)
+		}
+		return ipNet, nil
+	default:
+		return nil, fmt.Errorf("cannot use %T as *net.IPNet", def)
+	}
+}
@@ -0,0 +1,133 @@
+// Original work, Copyright 2017 Pantomath SAS
+// Modified work, Copyright (c) 2019 Charles Francoise
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package popt
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestCoercions(t *testing.T) {
+	tests := []struct {
+		name    string
+		coerce  func(interface{}) (interface{}, error)
+		in      interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{"toInt/nil", toInt, nil, 0, false},
+		{"toInt/int", toInt, 42, 42, false},
+		{"toInt/float64", toInt, float64(42), 42, false},
+		{"toInt/invalid", toInt, "nope", nil, true},
+
+		{"toInt64/int", toInt64, 42, int64(42), false},
+		{"toInt64/float64", toInt64, float64(42), int64(42), false},
+
+		{"toUint/int", toUint, 42, uint(42), false},
+		{"toUint/invalid", toUint, "nope", nil, true},
+
+		{"toUint64/float64", toUint64, float64(42), uint64(42), false},
+
+		{"toFloat32/float64", toFloat32, float64(1.5), float32(1.5), false},
+
+		{"toStringSlice/[]string", toStringSlice, []string{"a", "b"}, []string{"a", "b"}, false},
+		{"toStringSlice/[]interface{}", toStringSlice, []interface{}{"a", "b"}, []string{"a", "b"}, false},
+		{"toStringSlice/bad element", toStringSlice, []interface{}{1}, nil, true},
+
+		{"toIntSlice/[]interface{}", toIntSlice, []interface{}{float64(1), float64(2)}, []int{1, 2}, false},
+		{"toIntSlice/bad element", toIntSlice, []interface{}{"nope"}, nil, true},
+
+		{"toBoolSlice/[]interface{}", toBoolSlice, []interface{}{true, false}, []bool{true, false}, false},
+		{"toBoolSlice/bad element", toBoolSlice, []interface{}{"nope"}, nil, true},
+
+		{"toIP/string", toIP, "127.0.0.1", net.ParseIP("127.0.0.1"), false},
+		{"toIP/invalid", toIP, "not-an-ip", nil, true},
+
+		{"toIPMask/string", toIPMask, "255.255.255.0", net.IPMask(net.ParseIP("255.255.255.0").To4()), false},
+		{"toIPMask/invalid", toIPMask, "not-a-mask", nil, true},
+
+		{"toIPNet/string", toIPNet, "192.168.0.0/24", mustParseCIDR(t, "192.168.0.0/24"), false},
+		{"toIPNet/invalid", toIPNet, "not-a-cidr", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.coerce(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	t.Helper()
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("invalid test CIDR %q: %v", cidr, err)
+	}
+	return ipNet
+}
+
+func TestResolveOptionType(t *testing.T) {
+	t.Run("dispatch by Go type", func(t *testing.T) {
+		register, def, err := resolveOptionType(Option{Default: 8080})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if register == nil {
+			t.Fatal("expected a non-nil FlagRegisterer")
+		}
+		if def != 8080 {
+			t.Fatalf("got default %#v, want 8080", def)
+		}
+	})
+
+	t.Run("dispatch by named type", func(t *testing.T) {
+		register, def, err := resolveOptionType(Option{Type: "stringSlice", Default: []interface{}{"a", "b"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if register == nil {
+			t.Fatal("expected a non-nil FlagRegisterer")
+		}
+		if !reflect.DeepEqual(def, []string{"a", "b"}) {
+			t.Fatalf("got default %#v, want []string{\"a\", \"b\"}", def)
+		}
+	})
+
+	t.Run("unknown named type", func(t *testing.T) {
+		if _, _, err := resolveOptionType(Option{Type: "nope"}); err == nil {
+			t.Fatal("expected an error for an unknown option type")
+		}
+	})
+
+	t.Run("unsupported Go type", func(t *testing.T) {
+		if _, _, err := resolveOptionType(Option{Default: struct{}{}}); err == nil {
+			t.Fatal("expected an error for an unsupported Go type")
+		}
+	})
+}
@@ -0,0 +1,112 @@
+// Original work, Copyright 2017 Pantomath SAS
+// Modified work, Copyright (c) 2019 Charles Francoise
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package popt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// AddOptionToCommand adds opt to cmd, using cmd.PersistentFlags() instead of cmd.Flags()
+// when opt.Persistent is set, and marking the flag hidden afterwards when opt.Hidden is
+// set.
+//
+// AddOptionToCommand operates against the package-level viper singleton; use
+// (*Binder).AddOptionToCommand to target a specific *viper.Viper instead.
+func AddOptionToCommand(opt Option, cmd *cobra.Command) error {
+	return defaultBinder.AddOptionToCommand(opt, cmd)
+}
+
+// AddOptionToCommand is the Binder-aware equivalent of the package-level
+// AddOptionToCommand function.
+func (b *Binder) AddOptionToCommand(opt Option, cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	if opt.Persistent {
+		flags = cmd.PersistentFlags()
+	}
+
+	if err := addOption(opt, b.Viper, flags); err != nil {
+		return err
+	}
+
+	if opt.Hidden && opt.Flag != "" {
+		if err := flags.MarkHidden(opt.Flag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidationError aggregates every problem Validate finds across a batch of Options, so
+// callers see all of them at once instead of just the first.
+type ValidationError struct {
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d validation errors occurred: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the individual errors wrapped by e, for use with errors.Is and errors.As.
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+// Validate checks opts against the package-level viper singleton, once pflag.Parse() and
+// any config file have been read: every Required option must be set, and every Validate
+// callback must return nil for the option's resolved value. It returns a *ValidationError
+// aggregating every problem found, or nil if there were none.
+//
+// Validate operates against the package-level viper singleton; use (*Binder).Validate to
+// target a specific *viper.Viper instead.
+func Validate(opts []Option) error {
+	return defaultBinder.Validate(opts)
+}
+
+// Validate is the Binder-aware equivalent of the package-level Validate function.
+func (b *Binder) Validate(opts []Option) error {
+	var errs []error
+
+	for _, opt := range opts {
+		if opt.Required && opt.Name != "" && !b.Viper.IsSet(opt.Name) {
+			errs = append(errs, fmt.Errorf("option %q is required", opt.Name))
+			continue
+		}
+
+		if opt.Validate == nil {
+			continue
+		}
+		if err := opt.Validate(b.Viper.Get(opt.Name)); err != nil {
+			errs = append(errs, fmt.Errorf("option %q: %w", opt.Name, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
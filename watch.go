@@ -0,0 +1,211 @@
+// Original work, Copyright 2017 Pantomath SAS
+// Modified work, Copyright (c) 2019 Charles Francoise
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package popt
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchListener is one subscription registered through Watch or OnChange. snapshot holds
+// the value of each of opts' viper key the last time this particular listener ran, so
+// independent listeners on the same Binder don't interfere with each other's diffs.
+type watchListener struct {
+	opts     []Option
+	snapshot map[string]interface{}
+	notify   func(changed []Option)
+}
+
+// watchState is the dispatcher shared by every Watch/OnChange call on a Binder. viper
+// only keeps a single OnConfigChange callback at a time, so this fans a single reload
+// event out to every registered listener instead of letting later calls clobber earlier
+// ones.
+//
+// listeners is read from the fsnotify-driven OnConfigChange goroutine and mutated from
+// whatever goroutine calls Watch/OnChange or a subscription's stop func, so mu guards it.
+type watchState struct {
+	started   bool
+	mu        sync.Mutex
+	listeners []*watchListener
+}
+
+// Watch wraps viper.WatchConfig/OnConfigChange and delivers change events as the subset
+// of opts whose resolved value actually differs between reloads. It snapshots each
+// opt.Name's current value, then on every config reload re-reads them and calls onChange
+// with only the Options whose value changed.
+//
+// When b was populated via Register/RegisterAndBind, the comparison decodes a fresh copy
+// of that struct through mapstructure and diffs the typed field values with
+// reflect.DeepEqual, rather than the raw values viper.Get would return, so representation
+// drift that doesn't change the decoded value (e.g. "1h" versus "60m" for a
+// time.Duration) doesn't produce a false change notification. Without a registered dst,
+// it falls back to diffing viper.Get(opt.Name) directly.
+//
+// The returned stop function removes this particular subscription; other Watch or
+// OnChange subscriptions on the same Binder keep running.
+//
+// Watch operates against the package-level viper singleton; use (*Binder).Watch to target
+// a specific *viper.Viper instead.
+func Watch(opts []Option, onChange func(changed []Option)) (stop func(), err error) {
+	return defaultBinder.Watch(opts, onChange)
+}
+
+// Watch is the Binder-aware equivalent of the package-level Watch function.
+func (b *Binder) Watch(opts []Option, onChange func(changed []Option)) (func(), error) {
+	w := b.ensureWatching()
+
+	l := &watchListener{
+		opts:     opts,
+		snapshot: b.snapshotOptions(opts),
+		notify:   onChange,
+	}
+
+	w.mu.Lock()
+	w.listeners = append(w.listeners, l)
+	w.mu.Unlock()
+
+	return func() { b.removeListener(l) }, nil
+}
+
+// OnChange subscribes to a single Option's changes, calling onChange with the value
+// before and after each reload that actually changes it. It layers on the same
+// dispatcher as Watch, so independent subsystems can each call OnChange without
+// stepping on one another's viper.OnConfigChange registration.
+//
+// OnChange operates against the package-level viper singleton; use (*Binder).OnChange to
+// target a specific *viper.Viper instead.
+func OnChange(opt Option, onChange func(old, new interface{})) (stop func(), err error) {
+	return defaultBinder.OnChange(opt, onChange)
+}
+
+// OnChange is the Binder-aware equivalent of the package-level OnChange function.
+func (b *Binder) OnChange(opt Option, onChange func(old, new interface{})) (func(), error) {
+	last := b.Viper.Get(opt.Name)
+	return b.Watch([]Option{opt}, func(changed []Option) {
+		next := b.Viper.Get(opt.Name)
+		onChange(last, next)
+		last = next
+	})
+}
+
+// ensureWatching lazily starts viper's config watcher and installs the single
+// OnConfigChange handler that fans out to every listener, the first time Watch or
+// OnChange is called on b. b.mu guards the check-and-set of b.watch/b.watch.started, the
+// same as it guards b.dst, since independent subsystems calling Watch/OnChange
+// concurrently is the expected use case, not a corner case.
+func (b *Binder) ensureWatching() *watchState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.watch == nil {
+		b.watch = &watchState{}
+	}
+	if !b.watch.started {
+		b.watch.started = true
+		b.Viper.OnConfigChange(func(fsnotify.Event) {
+			b.dispatchChange()
+		})
+		b.Viper.WatchConfig()
+	}
+	return b.watch
+}
+
+// dispatchChange re-reads every listener's options and notifies it with the subset that
+// changed since its last snapshot. It snapshots the listener slice under the lock and
+// then runs outside it, so a listener's notify callback is free to call Watch or a stop
+// func without deadlocking. The typed snapshot is decoded once per reload and shared
+// across every listener, rather than once per listener, since it doesn't depend on which
+// options a given listener is watching.
+func (b *Binder) dispatchChange() {
+	b.watch.mu.Lock()
+	listeners := make([]*watchListener, len(b.watch.listeners))
+	copy(listeners, b.watch.listeners)
+	b.watch.mu.Unlock()
+
+	typed, err := b.typedSnapshot()
+	if err != nil {
+		typed = nil
+	}
+
+	for _, l := range listeners {
+		next := b.snapshotOptionsFrom(l.opts, typed)
+
+		var changed []Option
+		for _, opt := range l.opts {
+			if opt.Name == "" {
+				continue
+			}
+			if !reflect.DeepEqual(l.snapshot[opt.Name], next[opt.Name]) {
+				changed = append(changed, opt)
+			}
+		}
+
+		l.snapshot = next
+		if len(changed) > 0 {
+			l.notify(changed)
+		}
+	}
+}
+
+// snapshotOptions reads the current value of each named option in opts, preferring the
+// mapstructure-decoded typed value from typedSnapshot over the raw b.Viper.Get result
+// when b has a registered dst to decode into.
+func (b *Binder) snapshotOptions(opts []Option) map[string]interface{} {
+	typed, err := b.typedSnapshot()
+	if err != nil {
+		typed = nil
+	}
+	return b.snapshotOptionsFrom(opts, typed)
+}
+
+// snapshotOptionsFrom is the shared implementation behind snapshotOptions and
+// dispatchChange, taking an already-decoded typed snapshot (or nil, to always fall back
+// to b.Viper.Get) so dispatchChange can compute it once per reload instead of once per
+// listener.
+func (b *Binder) snapshotOptionsFrom(opts []Option, typed map[string]interface{}) map[string]interface{} {
+	snapshot := make(map[string]interface{}, len(opts))
+	for _, opt := range opts {
+		if opt.Name == "" {
+			continue
+		}
+		if v, ok := typed[opt.Name]; ok {
+			snapshot[opt.Name] = v
+			continue
+		}
+		snapshot[opt.Name] = b.Viper.Get(opt.Name)
+	}
+	return snapshot
+}
+
+// removeListener drops l from b's watch dispatcher, as returned by Watch's stop func.
+func (b *Binder) removeListener(l *watchListener) {
+	if b.watch == nil {
+		return
+	}
+
+	b.watch.mu.Lock()
+	defer b.watch.mu.Unlock()
+
+	kept := make([]*watchListener, 0, len(b.watch.listeners))
+	for _, existing := range b.watch.listeners {
+		if existing != l {
+			kept = append(kept, existing)
+		}
+	}
+	b.watch.listeners = kept
+}
@@ -0,0 +1,130 @@
+// Original work, Copyright 2017 Pantomath SAS
+// Modified work, Copyright (c) 2019 Charles Francoise
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package popt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestTypedSnapshotDecodesDurationStrings(t *testing.T) {
+	type Config struct {
+		Timeout time.Duration `popt:"name=timeout,flag=timeout,default=30s"`
+	}
+
+	var cfg Config
+	v := viper.New()
+	b := &Binder{Viper: v}
+	if err := b.Register(&cfg); err != nil {
+		t.Fatalf("Register returned an error: %v", err)
+	}
+
+	// Simulate a config reload setting the option from a YAML-style string, the way
+	// viper would after reading a config file, rather than an already-typed value.
+	v.Set("timeout", "1h")
+
+	snapshot, err := b.typedSnapshot()
+	if err != nil {
+		t.Fatalf("typedSnapshot returned an error: %v", err)
+	}
+
+	got, ok := snapshot["timeout"].(time.Duration)
+	if !ok {
+		t.Fatalf("snapshot[\"timeout\"] = %#v, want a time.Duration", snapshot["timeout"])
+	}
+	if got != time.Hour {
+		t.Fatalf("got timeout %v, want %v", got, time.Hour)
+	}
+}
+
+func TestTypedSnapshotWithoutDstReturnsNil(t *testing.T) {
+	b := &Binder{Viper: viper.New()}
+	snapshot, err := b.typedSnapshot()
+	if err != nil {
+		t.Fatalf("typedSnapshot returned an error: %v", err)
+	}
+	if snapshot != nil {
+		t.Fatalf("got %#v, want nil when no dst is registered", snapshot)
+	}
+}
+
+func TestWatchNotifiesOnlyListenersWithChangedOptions(t *testing.T) {
+	v := viper.New()
+	b := &Binder{Viper: v}
+
+	host := Option{Name: "host"}
+	port := Option{Name: "port"}
+	v.Set("host", "localhost")
+	v.Set("port", 8080)
+
+	var hostChanges, portChanges [][]Option
+	if _, err := b.Watch([]Option{host}, func(changed []Option) {
+		hostChanges = append(hostChanges, changed)
+	}); err != nil {
+		t.Fatalf("Watch returned an error: %v", err)
+	}
+	if _, err := b.Watch([]Option{port}, func(changed []Option) {
+		portChanges = append(portChanges, changed)
+	}); err != nil {
+		t.Fatalf("Watch returned an error: %v", err)
+	}
+
+	// Simulate a reload that only changes host, the way viper's OnConfigChange handler
+	// would fire after a config file write; dispatchChange is called directly rather than
+	// through ensureWatching's WatchConfig/fsnotify machinery, which needs a real file.
+	v.Set("host", "example.com")
+	b.dispatchChange()
+
+	if len(hostChanges) != 1 || len(hostChanges[0]) != 1 || hostChanges[0][0].Name != "host" {
+		t.Fatalf("got host listener changes %#v, want one notification for host", hostChanges)
+	}
+	if len(portChanges) != 0 {
+		t.Fatalf("got port listener changes %#v, want no notification since port didn't change", portChanges)
+	}
+}
+
+func TestOnChangeReceivesOldAndNewValues(t *testing.T) {
+	v := viper.New()
+	b := &Binder{Viper: v}
+	v.Set("timeout", 30)
+
+	var oldVal, newVal interface{}
+	calls := 0
+	if _, err := b.OnChange(Option{Name: "timeout"}, func(o, n interface{}) {
+		calls++
+		oldVal, newVal = o, n
+	}); err != nil {
+		t.Fatalf("OnChange returned an error: %v", err)
+	}
+
+	v.Set("timeout", 60)
+	b.dispatchChange()
+
+	if calls != 1 {
+		t.Fatalf("got %d onChange calls, want 1", calls)
+	}
+	if oldVal != 30 || newVal != 60 {
+		t.Fatalf("got onChange(%#v, %#v), want onChange(30, 60)", oldVal, newVal)
+	}
+
+	// A reload that doesn't change the watched option shouldn't call onChange again.
+	b.dispatchChange()
+	if calls != 1 {
+		t.Fatalf("got %d onChange calls after an unrelated reload, want still 1", calls)
+	}
+}